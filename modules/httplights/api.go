@@ -0,0 +1,200 @@
+package httplights
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"go.evanpurkhiser.com/atmosphere-automation/modules/lights"
+)
+
+// registerAPI mounts the built-in REST endpoints. It's called before
+// modules are registered, so modules may still add routes; since mux
+// matches routes in the order they were added, a module route with the
+// same path and method as a built-in one is never reached.
+func (s *Server) registerAPI(router *mux.Router) {
+	router.HandleFunc("/lights", s.handleGetLights).Methods(http.MethodGet)
+	router.HandleFunc("/scenes", s.handleGetScenes).Methods(http.MethodGet)
+	router.HandleFunc("/scenes/{name}/recall", s.handleRecallScene).Methods(http.MethodPost)
+	router.HandleFunc("/groups/{id}/state", s.handleSetGroupState).Methods(http.MethodPost)
+	router.HandleFunc("/bridge/info", s.handleBridgeInfo).Methods(http.MethodGet)
+	router.HandleFunc("/bridge/pair", s.handleBridgePair).Methods(http.MethodPost)
+}
+
+// controllerFor resolves the controller a request targets: the
+// `controller` query parameter if given, otherwise DefaultController.
+func (s *Server) controllerFor(r *http.Request) (lights.Controller, error) {
+	name := r.URL.Query().Get("controller")
+	if name == "" {
+		name = s.DefaultController
+	}
+
+	controller, ok := s.Controllers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown controller %q", name)
+	}
+
+	return controller, nil
+}
+
+func (s *Server) handleGetLights(w http.ResponseWriter, r *http.Request) {
+	controller, err := s.controllerFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lights, err := controller.GetLights()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, lights)
+}
+
+func (s *Server) handleGetScenes(w http.ResponseWriter, r *http.Request) {
+	controller, err := s.controllerFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lister, ok := controller.(lights.SceneLister)
+	if !ok {
+		http.Error(w, "controller does not support listing scenes", http.StatusNotImplemented)
+		return
+	}
+
+	scenes, err := lister.ListScenes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	writeJSON(w, scenes)
+}
+
+func (s *Server) handleRecallScene(w http.ResponseWriter, r *http.Request) {
+	controller, err := s.controllerFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+
+	if err := controller.RecallScene(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleSetGroupState(w http.ResponseWriter, r *http.Request) {
+	controller, err := s.controllerFor(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid group id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		On bool `json:"on"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := controller.SetGroupState(id, body.On); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleBridgeInfo(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.Controllers))
+	for name := range s.Controllers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeJSON(w, struct {
+		Controllers []string `json:"controllers"`
+	}{names})
+}
+
+// bridgePairing is the shape persisted to ConfigPath after a successful
+// pairing.
+type bridgePairing struct {
+	Username string `json:"username"`
+}
+
+func (s *Server) handleBridgePair(w http.ResponseWriter, r *http.Request) {
+	if s.Pairer == nil {
+		http.Error(w, "pairing is not supported by this server's controller", http.StatusNotImplemented)
+		return
+	}
+
+	username, err := s.Pairer.CreateUser("atmosphere-automation")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if err := s.persistPairing(username); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, bridgePairing{Username: username})
+}
+
+// persistPairing writes the paired username to ConfigPath so first-time
+// setup doesn't require hand-editing credentials. ConfigPath may hold other
+// settings alongside the pairing, so the existing contents are read and
+// merged rather than overwritten.
+func (s *Server) persistPairing(username string) error {
+	if s.ConfigPath == "" {
+		return fmt.Errorf("no config path configured to persist bridge pairing to")
+	}
+
+	config := map[string]any{}
+
+	if data, err := os.ReadFile(s.ConfigPath); err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("parsing existing config at %s: %w", s.ConfigPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	config["username"] = username
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.ConfigPath, data, 0o600)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,45 @@
+package httplights
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"go.evanpurkhiser.com/atmosphere-automation/modules/lights"
+)
+
+// registerOperationalRoutes mounts /healthz, /readyz and /metrics, letting
+// the daemon be operated under systemd or Kubernetes.
+func (s *Server) registerOperationalRoutes(router *mux.Router) {
+	router.Handle("/metrics", promhttp.Handler())
+	router.HandleFunc("/healthz", s.handleHealthz).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", s.handleReadyz).Methods(http.MethodGet)
+}
+
+// handleHealthz reports liveness: the process is up and serving requests.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleReadyz reports readiness by probing that every registered
+// controller's bridge is currently reachable.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	for name, controller := range s.Controllers {
+		if checker, ok := controller.(lights.ReachabilityChecker); ok {
+			if err := checker.Reachable(); err != nil {
+				http.Error(w, fmt.Sprintf("controller %q unreachable: %s", name, err), http.StatusServiceUnavailable)
+				return
+			}
+			continue
+		}
+
+		if _, err := controller.GetLights(); err != nil {
+			http.Error(w, fmt.Sprintf("controller %q unreachable: %s", name, err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,17 +1,25 @@
 package httplights
 
 import (
+	"context"
 	"net/http"
+	"time"
 
-	"github.com/collinux/gohue"
 	"github.com/gorilla/mux"
+
+	"go.evanpurkhiser.com/atmosphere-automation/modules/lights"
 )
 
+// shutdownTimeout bounds how long Run waits for in-flight requests to
+// complete after ctx is canceled before giving up.
+const shutdownTimeout = 10 * time.Second
+
 // HTTPLightsModule is an interface that can be implemented to allow a type to
 // be registered as a http controlling lights module in the httplights.Server.
 type HTTPLightsModule interface {
-	// SetHueBridge configures the hue bridge used by the module.
-	SetHueBridge(*hue.Bridge)
+	// SetControllers configures the set of named light controllers the
+	// module may drive scenes and groups on.
+	SetControllers(map[string]lights.Controller)
 
 	// RegisterInRouter asks the module to register itself in a mux router.
 	RegisterInRouter(*mux.Router)
@@ -21,27 +29,113 @@ type HTTPLightsModule interface {
 }
 
 // Server provides a means to register http controlled light modules that may
-// be triggered over http.
+// be triggered over http. It also exposes a built-in REST API for common
+// scene and group actions, backed by the same registered controllers.
 type Server struct {
-	// HueBridge configures the bridge to control lights through
-	HueBridge *hue.Bridge
+	// Controllers maps a controller name, as referenced by modules and the
+	// built-in REST API, to the lights.Controller implementation driving it.
+	Controllers map[string]lights.Controller
+
+	// DefaultController is the controller name the built-in REST API
+	// operates on unless a request overrides it with a `controller` query
+	// parameter.
+	DefaultController string
+
+	// Pairer, if set, backs the POST /bridge/pair endpoint.
+	Pairer lights.Pairer
+
+	// ConfigPath is the file a successful /bridge/pair persists the
+	// returned username to.
+	ConfigPath string
+
+	// Address is the address the server listens on, e.g. "127.0.0.1:8080".
+	// Defaults to ":8080".
+	Address string
+
+	// AuthToken, if set, is the bearer token required by every request to
+	// the server except /healthz, /readyz and /metrics.
+	AuthToken string
 
 	modules []HTTPLightsModule
 }
 
+// RegisterController registers a named lights.Controller which modules and
+// the built-in REST API may target scenes and groups on.
+func (s *Server) RegisterController(name string, controller lights.Controller) {
+	if s.Controllers == nil {
+		s.Controllers = map[string]lights.Controller{}
+	}
+
+	s.Controllers[name] = controller
+}
+
 // RegisterModule registers a http lights module.
 func (s *Server) RegisterModule(module HTTPLightsModule) {
 	s.modules = append(s.modules, module)
 }
 
-// Start starts the http light server
-func (s *Server) Start() {
+// Run starts the http light server and blocks until ctx is canceled, at
+// which point it gracefully shuts down, waiting up to shutdownTimeout for
+// in-flight requests to finish.
+func (s *Server) Run(ctx context.Context) error {
 	router := mux.NewRouter()
 
+	// Operational routes are exempt from auth: Prometheus scrapes and
+	// Kubernetes/systemd health checks don't carry the bearer token.
+	s.registerOperationalRoutes(router)
+
+	protected := router.NewRoute().Subrouter()
+	protected.Use(s.requireAuth)
+
+	s.registerAPI(protected)
+
 	for _, module := range s.modules {
-		module.RegisterInRouter(router)
-		module.SetHueBridge(s.HueBridge)
+		module.RegisterInRouter(protected)
+		module.SetControllers(s.Controllers)
+	}
+
+	address := s.Address
+	if address == "" {
+		address = ":8080"
 	}
 
-	go http.ListenAndServe(":8080", router)
-}
\ No newline at end of file
+	httpServer := &http.Server{Addr: address, Handler: router}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+			return
+		}
+		serveErr <- nil
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		return httpServer.Shutdown(shutdownCtx)
+
+	case err := <-serveErr:
+		return err
+	}
+}
+
+// requireAuth is middleware that rejects requests missing the configured
+// bearer token. It's a no-op when AuthToken isn't set.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.AuthToken == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+s.AuthToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
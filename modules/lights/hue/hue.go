@@ -0,0 +1,69 @@
+// Package hue implements the lights.Controller interface for a Philips Hue
+// bridge using the gohue REST API.
+package hue
+
+import (
+	gohue "github.com/collinux/gohue"
+
+	"go.evanpurkhiser.com/atmosphere-automation/modules/lights"
+)
+
+// Driver drives a single Philips Hue bridge.
+type Driver struct {
+	Bridge *gohue.Bridge
+}
+
+// New returns a Driver wrapping the given Hue bridge.
+func New(bridge *gohue.Bridge) *Driver {
+	return &Driver{Bridge: bridge}
+}
+
+// RecallScene implements lights.Controller.
+func (d *Driver) RecallScene(name string) error {
+	return d.Bridge.RecallSceneByName(name)
+}
+
+// GetLights implements lights.Controller.
+func (d *Driver) GetLights() ([]lights.Light, error) {
+	hueLights, err := d.Bridge.GetAllLights()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]lights.Light, len(hueLights))
+
+	for i, light := range hueLights {
+		result[i] = lights.Light{
+			ID:   light.Index,
+			Name: light.Name,
+			On:   light.State.On,
+		}
+	}
+
+	return result, nil
+}
+
+// SetGroupState implements lights.Controller.
+func (d *Driver) SetGroupState(id int, on bool) error {
+	return d.Bridge.SetGroupState(id, &gohue.Action{On: &on})
+}
+
+// AllOff implements lights.Controller. Group 0 is a special group reserved
+// by the Hue v1 API meaning every light known to the bridge.
+func (d *Driver) AllOff() error {
+	off := false
+	return d.Bridge.SetGroupState(0, &gohue.Action{On: &off})
+}
+
+// SceneExists implements lights.Controller.
+func (d *Driver) SceneExists(name string) error {
+	_, err := d.Bridge.GetSceneByName(name)
+	return err
+}
+
+// CreateUser implements lights.Pairer. It must be called within the
+// bridge's pairing window, i.e. shortly after the physical link button has
+// been pressed.
+func (d *Driver) CreateUser(deviceType string) (string, error) {
+	return d.Bridge.CreateUser(deviceType)
+}
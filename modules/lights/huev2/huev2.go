@@ -0,0 +1,505 @@
+// Package huev2 drives a Philips Hue bridge over its CLIP v2 API. Unlike
+// the v1 REST driver in modules/lights/hue, it keeps an in-memory cache of
+// light state that is kept current by consuming the bridge's
+// /eventstream/clip/v2 Server-Sent Events, so checks like "is anything on"
+// don't pay for a full bridge REST round trip on every call.
+package huev2
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.evanpurkhiser.com/atmosphere-automation/modules/lights"
+)
+
+const (
+	// reconnectMinBackoff and reconnectMaxBackoff bound the exponential
+	// backoff used when the event stream connection drops.
+	reconnectMinBackoff = 1 * time.Second
+	reconnectMaxBackoff = 1 * time.Minute
+
+	// updateCooldown coalesces bursts of SSE updates, such as those
+	// following a scene recall, so applying the cache doesn't thrash under
+	// a stampede of near-simultaneous events.
+	updateCooldown = 500 * time.Millisecond
+
+	// staleAfter is how long the cache may go without successfully
+	// communicating with the bridge, either via a resync or an applied
+	// event stream update, before Reachable reports it as unreachable.
+	staleAfter = 5 * time.Minute
+)
+
+// cachedLight is the subset of a CLIP v2 `light` resource this driver
+// tracks.
+type cachedLight struct {
+	id   string
+	name string
+	on   bool
+}
+
+// Driver implements lights.Controller against a Hue bridge's CLIP v2 API.
+// Call Start before use to seed the cache and begin consuming the bridge's
+// event stream.
+//
+// CLIP v2 addresses every resource by UUID rather than the small integer
+// ids the lights.Controller interface inherits from the v1 API. To stay
+// compatible, Driver assigns each light and group a stable synthetic int
+// id, in the order they were first seen, and maps back to the underlying
+// UUID internally.
+type Driver struct {
+	// Address is the bridge's hostname or IP address.
+	Address string
+
+	// AppKey is the `hue-application-key` header value used to
+	// authenticate CLIP v2 requests, obtained via the bridge pairing flow.
+	AppKey string
+
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	lights      map[int]*cachedLight
+	groupIDs    map[int]string // synthetic id -> grouped_light resource id
+	scenes      map[string]string // scene name -> scene resource id
+	nextID      int
+	lastSuccess time.Time
+}
+
+// New returns a Driver for the bridge at address, authenticating CLIP v2
+// requests with appKey.
+func New(address, appKey string) *Driver {
+	return &Driver{
+		Address: address,
+		AppKey:  appKey,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				// Hue bridges serve the CLIP v2 API over HTTPS with a
+				// self-signed certificate.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		lights:   map[int]*cachedLight{},
+		groupIDs: map[int]string{},
+		scenes:   map[string]string{},
+	}
+}
+
+// Start seeds the resource cache with a single GET /clip/v2/resource call
+// and then begins consuming the bridge's event stream in the background to
+// keep it current.
+func (d *Driver) Start() error {
+	if err := d.resync(); err != nil {
+		return err
+	}
+
+	go d.consumeEvents()
+
+	return nil
+}
+
+// Reachable implements lights.ReachabilityChecker. GetLights only ever reads
+// the local cache and so can't itself detect a bridge or event stream that's
+// gone silent; Reachable reports an error once the cache hasn't been
+// refreshed, by resync or applied event stream update, in over staleAfter.
+func (d *Driver) Reachable() error {
+	d.mu.Lock()
+	lastSuccess := d.lastSuccess
+	d.mu.Unlock()
+
+	if time.Since(lastSuccess) > staleAfter {
+		return fmt.Errorf("huev2: cache last refreshed %s ago, exceeding %s", time.Since(lastSuccess), staleAfter)
+	}
+
+	return nil
+}
+
+// AnyLightOn reports whether any cached light is currently on.
+func (d *Driver) AnyLightOn() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, light := range d.lights {
+		if light.on {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetLights implements lights.Controller.
+func (d *Driver) GetLights() ([]lights.Light, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]lights.Light, 0, len(d.lights))
+	for id, light := range d.lights {
+		result = append(result, lights.Light{ID: id, Name: light.name, On: light.on})
+	}
+
+	return result, nil
+}
+
+// SceneExists implements lights.Controller.
+func (d *Driver) SceneExists(name string) error {
+	d.mu.Lock()
+	_, ok := d.scenes[name]
+	d.mu.Unlock()
+
+	if ok {
+		return nil
+	}
+
+	return fmt.Errorf("huev2: scene %q does not exist", name)
+}
+
+// ListScenes implements lights.SceneLister.
+func (d *Driver) ListScenes() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	names := make([]string, 0, len(d.scenes))
+	for name := range d.scenes {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// RecallScene implements lights.Controller.
+func (d *Driver) RecallScene(name string) error {
+	d.mu.Lock()
+	id, ok := d.scenes[name]
+	d.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("huev2: scene %q does not exist", name)
+	}
+
+	body := strings.NewReader(`{"recall":{"action":"active"}}`)
+
+	return d.put(fmt.Sprintf("/clip/v2/resource/scene/%s", id), body)
+}
+
+// SetGroupState implements lights.Controller.
+func (d *Driver) SetGroupState(id int, on bool) error {
+	d.mu.Lock()
+	groupID, ok := d.groupIDs[id]
+	d.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("huev2: group %d does not exist", id)
+	}
+
+	body := strings.NewReader(fmt.Sprintf(`{"on":{"on":%t}}`, on))
+
+	return d.put(fmt.Sprintf("/clip/v2/resource/grouped_light/%s", groupID), body)
+}
+
+// AllOff implements lights.Controller. CLIP v2 has no group-0 equivalent
+// for "every light on the bridge," so each cached light is turned off
+// individually.
+func (d *Driver) AllOff() error {
+	d.mu.Lock()
+	ids := make([]string, 0, len(d.lights))
+	for _, light := range d.lights {
+		ids = append(ids, light.id)
+	}
+	d.mu.Unlock()
+
+	for _, id := range ids {
+		body := strings.NewReader(`{"on":{"on":false}}`)
+		if err := d.put(fmt.Sprintf("/clip/v2/resource/light/%s", id), body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) put(path string, body io.Reader) error {
+	req, err := http.NewRequest(http.MethodPut, "https://"+d.Address+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("hue-application-key", d.AppKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("huev2: request to %s failed with status %s", path, resp.Status)
+	}
+
+	return nil
+}
+
+// resourceEnvelope is the shape shared by both the GET /clip/v2/resource
+// response and each CLIP v2 Server-Sent Event.
+type resourceEnvelope struct {
+	Data []resource `json:"data"`
+}
+
+type resource struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	On *struct {
+		On bool `json:"on"`
+	} `json:"on"`
+	Owner struct {
+		RID string `json:"rid"`
+	} `json:"owner"`
+}
+
+// resync fetches the full current resource set and rebuilds the cache from
+// scratch, pruning any previously cached light, group or scene absent from
+// the response. It is used both for the initial seed and to recover after
+// the event stream drops events we can't otherwise account for.
+func (d *Driver) resync() error {
+	req, err := http.NewRequest(http.MethodGet, "https://"+d.Address+"/clip/v2/resource", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("hue-application-key", d.AppKey)
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("huev2: resource request failed with status %s", resp.Status)
+	}
+
+	var envelope resourceEnvelope
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seenLights := make(map[string]bool, len(envelope.Data))
+	seenGroups := make(map[string]bool, len(envelope.Data))
+	seenScenes := make(map[string]bool, len(envelope.Data))
+
+	for _, res := range envelope.Data {
+		switch res.Type {
+		case "light":
+			seenLights[res.ID] = true
+		case "grouped_light":
+			seenGroups[res.ID] = true
+		case "scene":
+			seenScenes[res.Metadata.Name] = true
+		}
+
+		d.applyLocked(res)
+	}
+
+	for id, light := range d.lights {
+		if !seenLights[light.id] {
+			delete(d.lights, id)
+		}
+	}
+	for id, groupID := range d.groupIDs {
+		if !seenGroups[groupID] {
+			delete(d.groupIDs, id)
+		}
+	}
+	for name := range d.scenes {
+		if !seenScenes[name] {
+			delete(d.scenes, name)
+		}
+	}
+
+	d.lastSuccess = time.Now()
+
+	return nil
+}
+
+// applyLocked merges a single resource (from the initial seed or an SSE
+// update) into the cache. d.mu must be held by the caller.
+func (d *Driver) applyLocked(res resource) {
+	switch res.Type {
+	case "light":
+		light, ok := d.lights[d.idForLocked(res.ID)]
+		if !ok {
+			id := d.nextID
+			d.nextID++
+			light = &cachedLight{id: res.ID, name: res.Metadata.Name}
+			d.lights[id] = light
+		}
+		if res.Metadata.Name != "" {
+			light.name = res.Metadata.Name
+		}
+		if res.On != nil {
+			light.on = res.On.On
+		}
+
+	case "grouped_light":
+		if _, ok := d.idForGroupLocked(res.ID); !ok {
+			id := d.nextID
+			d.nextID++
+			d.groupIDs[id] = res.ID
+		}
+
+	case "scene":
+		d.scenes[res.Metadata.Name] = res.ID
+	}
+}
+
+func (d *Driver) idForLocked(resourceID string) int {
+	for id, light := range d.lights {
+		if light.id == resourceID {
+			return id
+		}
+	}
+	return -1
+}
+
+func (d *Driver) idForGroupLocked(resourceID string) (int, bool) {
+	for id, rid := range d.groupIDs {
+		if rid == resourceID {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// consumeEvents connects to the bridge's SSE event stream and applies
+// updates to the cache until the stream closes, reconnecting with
+// exponential backoff. It never returns; it is intended to be run in its
+// own goroutine for the lifetime of the Driver.
+func (d *Driver) consumeEvents() {
+	backoff := reconnectMinBackoff
+
+	for {
+		// The stream only returns once the connection has dropped, so
+		// whatever events we missed while reconnecting need a full
+		// resync rather than a best-effort catch-up.
+		_ = d.streamOnce()
+
+		time.Sleep(backoff + time.Duration(rand.Int63n(int64(backoff)/2+1)))
+
+		if err := d.resync(); err != nil {
+			backoff *= 2
+			if backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+			continue
+		}
+
+		backoff = reconnectMinBackoff
+	}
+}
+
+// streamOnce opens a single connection to the event stream and reads
+// events from it until the connection closes or an error occurs.
+func (d *Driver) streamOnce() error {
+	req, err := http.NewRequest(http.MethodGet, "https://"+d.Address+"/eventstream/clip/v2", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("hue-application-key", d.AppKey)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("huev2: event stream request failed with status %s", resp.Status)
+	}
+
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	var pending []resource
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+
+		d.mu.Lock()
+		for _, res := range pending {
+			d.applyLocked(res)
+		}
+		d.lastSuccess = time.Now()
+		d.mu.Unlock()
+
+		pending = nil
+	}
+
+	// Coalesce bursts of updates, such as those following a scene recall,
+	// flushing updateCooldown after the first update in a burst arrives.
+	// The timer is armed on demand rather than reset per line so a burst's
+	// trailing update still flushes even if the stream goes quiet for a
+	// while afterwards.
+	cooldown := time.NewTimer(updateCooldown)
+	if !cooldown.Stop() {
+		<-cooldown.C
+	}
+	cooldownArmed := false
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				return <-scanErr
+			}
+
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+
+			var envelopes []resourceEnvelope
+			if err := json.Unmarshal([]byte(data), &envelopes); err != nil {
+				continue
+			}
+
+			for _, envelope := range envelopes {
+				pending = append(pending, envelope.Data...)
+			}
+
+			if !cooldownArmed {
+				cooldown.Reset(updateCooldown)
+				cooldownArmed = true
+			}
+
+		case <-cooldown.C:
+			cooldownArmed = false
+			flush()
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package lifx is a skeleton lights.Controller implementation for LIFX
+// bulbs. LIFX devices are controlled directly over a local UDP protocol
+// rather than through a central bridge, so this driver is not yet wired up
+// to the real LIFX LAN protocol. It exists so call sites can already target
+// a "lifx" controller by name and the real implementation can be dropped in
+// later without changing them.
+package lifx
+
+import (
+	"fmt"
+
+	"go.evanpurkhiser.com/atmosphere-automation/modules/lights"
+)
+
+// Driver is a not-yet-implemented lights.Controller for LIFX bulbs.
+type Driver struct{}
+
+// New returns a new, non-functional LIFX Driver.
+func New() *Driver {
+	return &Driver{}
+}
+
+// RecallScene implements lights.Controller.
+func (d *Driver) RecallScene(name string) error {
+	return fmt.Errorf("lifx: RecallScene is not yet implemented")
+}
+
+// GetLights implements lights.Controller.
+func (d *Driver) GetLights() ([]lights.Light, error) {
+	return nil, fmt.Errorf("lifx: GetLights is not yet implemented")
+}
+
+// SetGroupState implements lights.Controller.
+func (d *Driver) SetGroupState(id int, on bool) error {
+	return fmt.Errorf("lifx: SetGroupState is not yet implemented")
+}
+
+// AllOff implements lights.Controller.
+func (d *Driver) AllOff() error {
+	return fmt.Errorf("lifx: AllOff is not yet implemented")
+}
+
+// SceneExists implements lights.Controller.
+func (d *Driver) SceneExists(name string) error {
+	return fmt.Errorf("lifx: SceneExists is not yet implemented")
+}
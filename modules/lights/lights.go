@@ -0,0 +1,78 @@
+// Package lights defines a vendor-neutral interface for driving light
+// systems (Philips Hue, LIFX, ...) so that modules can recall scenes and
+// inspect light state without depending on a specific bridge API.
+package lights
+
+// Light represents the basic state of a single light as reported by a
+// Controller.
+type Light struct {
+	ID   int
+	Name string
+	On   bool
+}
+
+// Controller is implemented by light system drivers to provide a common
+// interface for triggering scenes and inspecting light state. Modules
+// register against one or more named Controllers, allowing a single
+// trigger to target scenes on whichever bridge or vendor backs that name,
+// including setups with multiple bridges or mixed vendors.
+type Controller interface {
+	// RecallScene activates the named scene.
+	RecallScene(name string) error
+
+	// GetLights returns the current state of all lights known to the
+	// controller.
+	GetLights() ([]Light, error)
+
+	// SetGroupState turns the group of lights identified by id on or off.
+	SetGroupState(id int, on bool) error
+
+	// AllOff turns off every light known to the controller. Unlike
+	// SetGroupState, it doesn't depend on a vendor-specific "all lights"
+	// group id.
+	AllOff() error
+
+	// SceneExists returns nil if a scene with the given name exists on the
+	// controller, or an error describing why it doesn't.
+	SceneExists(name string) error
+}
+
+// SceneLister is implemented by Controllers that can enumerate the scenes
+// they know about. It's optional: some drivers only support checking a
+// single scene by name.
+type SceneLister interface {
+	// ListScenes returns the names of all known scenes.
+	ListScenes() ([]string, error)
+}
+
+// LightsOnProbe is implemented by Controllers that can report whether any
+// light is currently on without a full round trip to the bridge, such as a
+// driver backed by a locally maintained cache. It's optional: callers that
+// only have a plain Controller fall back to inspecting GetLights.
+type LightsOnProbe interface {
+	// AnyLightOn reports whether any light known to the controller is
+	// currently on.
+	AnyLightOn() bool
+}
+
+// ReachabilityChecker is implemented by Controllers whose GetLights reads
+// from a locally maintained cache rather than the bridge itself, so it can't
+// be used on its own to tell whether the bridge is actually reachable. It's
+// optional: callers that only have a plain Controller fall back to treating
+// a successful GetLights call as evidence of reachability.
+type ReachabilityChecker interface {
+	// Reachable returns nil if the controller has communicated with its
+	// backing bridge recently enough to be trusted, or an error describing
+	// why it hasn't.
+	Reachable() error
+}
+
+// Pairer is implemented by Controllers that support a bridge-style pairing
+// flow, where a user presses a physical button on the bridge and the
+// caller then exchanges that window of trust for lasting credentials.
+type Pairer interface {
+	// CreateUser registers a new API user of the given device type and
+	// returns its username/token. It must be called within the bridge's
+	// pairing window.
+	CreateUser(deviceType string) (username string, err error)
+}
@@ -1,11 +1,15 @@
 package lightson
 
 import (
+	"context"
 	"net"
+	"sync"
 	"time"
 
-	"github.com/collinux/gohue"
 	"github.com/sirupsen/logrus"
+
+	"go.evanpurkhiser.com/atmosphere-automation/modules/lights"
+	"go.evanpurkhiser.com/atmosphere-automation/modules/metrics"
 	"go.evanpurkhiser.com/netgear"
 )
 
@@ -14,138 +18,300 @@ import (
 // on or not.
 type ShouldTurnOn func() bool
 
-// DeviceLightsTrigger is a service that listens for a device to connect or
-// disconnect from the network and will trigger a specified hue scene.
+// PresenceChanged is called whenever aggregate presence is gained (the
+// score reaching the configured threshold) or lost (the score returning to
+// zero).
+type PresenceChanged func(present bool, devices []net.HardwareAddr)
+
+// PresenceDevice describes a single device tracked for occupancy, such as a
+// phone, laptop, or watch. The presence of several such devices is combined
+// into a single aggregate score, loosely modeled on how systems like
+// ninjasphere fuse multiple signals rather than trusting any one device.
+type PresenceDevice struct {
+	// MAC is the hardware address of the device to track.
+	MAC net.HardwareAddr
+
+	// Weight is how much this device contributes to the aggregate presence
+	// score while it counts as present.
+	Weight float64
+
+	// DebounceInterval is how long this device must be absent from the
+	// network before it stops counting towards the aggregate presence
+	// score. This allows the service to ignore devices that tend to
+	// disconnect and reconnect within a short period of time.
+	DebounceInterval time.Duration
+}
+
+// trackedDevice is the runtime state kept for a single PresenceDevice.
+type trackedDevice struct {
+	PresenceDevice
+
+	connected      bool
+	lastDisconnect time.Time
+}
+
+// present reports whether the device currently counts towards the
+// aggregate presence score.
+func (t *trackedDevice) present(now time.Time) bool {
+	if t.connected {
+		return true
+	}
+
+	return now.Sub(t.lastDisconnect) < t.DebounceInterval
+}
+
+// DeviceLightsTrigger is a service that tracks the aggregate presence of a
+// set of devices on the network and triggers a specified scene when
+// presence is gained or lost.
 type DeviceLightsTrigger struct {
-	// HueBridge specifies the bridge to communicate with for light changes.
-	HueBridge *hue.Bridge
+	// Controller specifies the lights.Controller to communicate with for
+	// light changes.
+	Controller lights.Controller
 
 	// NetgearClient specifies the client to the router that will be used to
 	// query for changes to the list of connected devices.
 	NetgearClient *netgear.Client
 
-	// TriggerDeviceMAC is the hardware address of the device that triggers the
-	// service to turn the lights on or off.
-	TriggerDeviceMAC net.HardwareAddr
+	// PresenceDevices is the set of devices whose combined presence
+	// determines whether the lights should be on.
+	PresenceDevices []PresenceDevice
+
+	// PresenceThreshold is the aggregate weight that must be met for
+	// presence to be considered gained. Lights turn on when the aggregate
+	// score crosses this threshold from zero, and off only once the score
+	// returns to zero, i.e. once every device has been absent longer than
+	// its own DebounceInterval.
+	PresenceThreshold float64
 
-	// SceneName specifies the name of the scene to trigger when the device
-	// connects to the network.
-	SceneName string
+	// SceneSelector picks which scene to recall when presence is gained,
+	// based on time-of-day, sun-position and day-of-week rules.
+	SceneSelector *SceneSelector
 
 	// RouterPollInterval specifies the time between queries to the router to
-	// determine if the device has been connected or disconnected.
+	// determine if a device has connected or disconnected, and also the
+	// interval at which presence is re-evaluated to catch devices aging out
+	// of their DebounceInterval.
 	RouterPollInterval time.Duration
 
-	// DebouceInterval specifies the time to wait before powering the lights
-	// off and the time range which the lights should not be powered on after a
-	// disconnect. This allows the service to wait to ensure the device is not
-	// reconnected to the network, as some devices tend to disconnect and
-	// reconnect within a short period of time.
-	DebouceInterval time.Duration
-
 	// ShouldTurnOnHooks is a list of ShouldTurnOn functions that will be
 	// executed prior to the lights being turned on. Should any return false,
 	// the lights will not turn on.
 	ShouldTurnOnHooks []ShouldTurnOn
 
+	presenceHooks []PresenceChanged
+
 	logger logrus.FieldLogger
+
+	mu      sync.Mutex
+	devices map[string]*trackedDevice
+	present bool
 }
 
-// lightsOff turns all lights off. This will wait wait before turning off the
-// lights as it's presumed I won't be home to care, however this timer may be
-// canceled should the lights be turned back on.
-func (dt *DeviceLightsTrigger) lightsOff(cancel chan bool) {
-	timer := time.NewTimer(dt.DebouceInterval)
+// OnPresenceChanged registers a hook to be called whenever the aggregate
+// presence state changes.
+func (dt *DeviceLightsTrigger) OnPresenceChanged(hook PresenceChanged) {
+	dt.presenceHooks = append(dt.presenceHooks, hook)
+}
 
-	select {
-	case <-cancel:
-		timer.Stop()
-		return
-	case <-timer.C:
-		break
+// lightsOff turns all lights off.
+func (dt *DeviceLightsTrigger) lightsOff() {
+	if err := dt.Controller.AllOff(); err != nil {
+		metrics.BridgeErrors.WithLabelValues("all_off").Inc()
 	}
-
-	nope := false
-	dt.HueBridge.SetGroupState(0, &hue.Action{On: &nope})
 }
 
-// lightsOn sets the lights to the specified scene. This will only recall the
-// scene given that all lights are currently off and that the last disconnect
-// doesn't fall within the debounce duration.
-func (dt *DeviceLightsTrigger) lightsOn(lastDisconnect time.Time) {
-	// Do nothing if we're before the debounce time
-	if time.Now().Sub(lastDisconnect) < dt.DebouceInterval {
-		return
+// anyLightOn reports whether any light the Controller knows about is
+// currently on, preferring a lights.LightsOnProbe when the Controller
+// implements one so the check doesn't pay for a full bridge round trip.
+func (dt *DeviceLightsTrigger) anyLightOn() bool {
+	if prober, ok := dt.Controller.(lights.LightsOnProbe); ok {
+		return prober.AnyLightOn()
 	}
 
-	lights, _ := dt.HueBridge.GetAllLights()
+	lightList, err := dt.Controller.GetLights()
+	if err != nil {
+		metrics.BridgeErrors.WithLabelValues("get_lights").Inc()
+		return false
+	}
 
-	// Do nothing if any of the lights are currently on
-	for _, light := range lights {
-		if light.State.On {
-			return
+	for _, light := range lightList {
+		if light.On {
+			return true
 		}
 	}
 
-	// Ensure all should turn on hooks pass
+	return false
+}
+
+// lightsOn recalls whichever scene the SceneSelector currently selects,
+// provided all should-turn-on hooks pass, no light is already on, and the
+// scene isn't within its recall cooldown.
+func (dt *DeviceLightsTrigger) lightsOn() {
 	for _, hook := range dt.ShouldTurnOnHooks {
 		if !hook() {
 			return
 		}
 	}
 
-	dt.HueBridge.RecallSceneByName(dt.SceneName)
+	if dt.anyLightOn() {
+		return
+	}
+
+	scene := dt.SceneSelector.Scene()
+	if !dt.SceneSelector.readyToRecall(scene) {
+		return
+	}
+
+	if err := dt.Controller.RecallScene(scene); err != nil {
+		metrics.SceneRecalls.WithLabelValues(scene, "error").Inc()
+		metrics.BridgeErrors.WithLabelValues("recall_scene").Inc()
+		return
+	}
+
+	metrics.SceneRecalls.WithLabelValues(scene, "success").Inc()
+	dt.SceneSelector.markRecalled(scene)
+}
+
+// evaluatePresence recomputes the aggregate presence score and, whenever
+// presence is gained (the score reaching the configured threshold) or lost
+// (the score returning to zero), triggers the lights and any registered
+// presence hooks.
+func (dt *DeviceLightsTrigger) evaluatePresence() {
+	dt.mu.Lock()
+
+	now := time.Now()
+
+	var score float64
+	var presentDevices []net.HardwareAddr
+
+	for _, device := range dt.devices {
+		if device.present(now) {
+			score += device.Weight
+			presentDevices = append(presentDevices, device.MAC)
+		}
+	}
+
+	wasPresent := dt.present
+
+	// Gaining presence requires crossing the threshold from zero; losing it
+	// requires every device to have aged out, i.e. the score returning to
+	// zero, not merely dropping back below the threshold.
+	isPresent := wasPresent && score > 0 || !wasPresent && score >= dt.PresenceThreshold
+
+	dt.present = isPresent
+	dt.mu.Unlock()
+
+	presentGauge := 0.0
+	if isPresent {
+		presentGauge = 1
+	}
+	metrics.DevicePresent.Set(presentGauge)
+
+	if isPresent == wasPresent {
+		return
+	}
+
+	dt.logger.
+		WithField("present", isPresent).
+		WithField("devices", presentDevices).
+		Info("Aggregate presence changed")
+
+	for _, hook := range dt.presenceHooks {
+		hook(isPresent, presentDevices)
+	}
+
+	if isPresent {
+		go dt.lightsOn()
+	} else {
+		go dt.lightsOff()
+	}
 }
 
-// Start boots the service and begins listening for devices to trigger lights.
-func (dt *DeviceLightsTrigger) Start() error {
-	// Ensure a valid scene was given
-	if _, err := dt.HueBridge.GetSceneByName(dt.SceneName); err != nil {
-		return err
+// Run boots the service and tracks presence of the configured devices
+// until ctx is canceled, at which point it stops its own presence
+// re-evaluation loop and returns.
+func (dt *DeviceLightsTrigger) Run(ctx context.Context) error {
+	// Ensure every scene the selector can choose actually exists
+	for _, scene := range dt.SceneSelector.allScenes() {
+		if err := dt.Controller.SceneExists(scene); err != nil {
+			return err
+		}
 	}
 
-	dt.logger = logrus.WithFields(logrus.Fields{
-		"module":      "lightson",
-		"mac_address": dt.TriggerDeviceMAC,
-	})
+	dt.logger = logrus.WithField("module", "lightson")
 
-	cancelPowerOff := make(chan bool, 1)
-	lastDisconnect := time.Now()
+	dt.devices = make(map[string]*trackedDevice, len(dt.PresenceDevices))
+	for _, device := range dt.PresenceDevices {
+		dt.devices[device.MAC.String()] = &trackedDevice{PresenceDevice: device}
+	}
 
 	listener := func(change *netgear.ChangedDevice, err error) {
 		if err != nil {
 			return
 		}
 
-		if change.Device.MAC.String() != dt.TriggerDeviceMAC.String() {
-			return
+		dt.mu.Lock()
+		device, tracked := dt.devices[change.Device.MAC.String()]
+		var debounceCancelled bool
+		if tracked {
+			if change.Change == netgear.DeviceRemoved {
+				device.connected = false
+				device.lastDisconnect = time.Now()
+			} else {
+				debounceCancelled = !device.connected && time.Since(device.lastDisconnect) < device.DebounceInterval
+				device.connected = true
+			}
 		}
+		dt.mu.Unlock()
 
-		dt.logger.
-			WithField("device_status", change.Change).
-			Infof("Detected device status change")
-
-		if change.Change == netgear.DeviceRemoved {
-			lastDisconnect = time.Now()
-			go dt.lightsOff(cancelPowerOff)
+		if !tracked {
 			return
 		}
 
-		cancelPowerOff <- true
-		close(cancelPowerOff)
-		cancelPowerOff = make(chan bool, 1)
-
-		go dt.lightsOn(lastDisconnect)
-	}
+		event := "connect"
+		if change.Change == netgear.DeviceRemoved {
+			event = "disconnect"
+		}
+		metrics.TriggerEvents.WithLabelValues(event).Inc()
 
-	dt.NetgearClient.OnDeviceChanged(dt.RouterPollInterval, listener)
+		if debounceCancelled {
+			metrics.DebounceCancellations.Inc()
+		}
 
-	dt.logger.Info("Listening for device connections.")
+		dt.logger.
+			WithField("mac_address", change.Device.MAC).
+			WithField("device_status", change.Change).
+			Info("Detected device status change")
 
-	// TODO: Add a DeviceLightsTrigger.Stop() method which ensures the
-	//       OnDeviceChanges call is also stopped. Currently this method
-	//       returns a ticker, which can be stopped however it will leave a go
-	//       routine in deadlock.
+		dt.evaluatePresence()
+	}
 
-	return nil
+	ticker := dt.NetgearClient.OnDeviceChanged(dt.RouterPollInterval, listener)
+
+	// Periodically re-evaluate presence even without a network change, so
+	// that a device aging out of its DebounceInterval is noticed.
+	reevaluate := time.NewTicker(dt.RouterPollInterval)
+	defer reevaluate.Stop()
+
+	dt.logger.Info("Listening for device presence changes.")
+
+	for {
+		select {
+		case <-ctx.Done():
+			// ticker.Stop() only stops future ticks; it doesn't close
+			// ticker.C. If OnDeviceChanged's background goroutine ranges
+			// over that channel rather than selecting on some other way to
+			// be told to exit, it's left parked on a channel that will
+			// never receive again. Without visibility into that goroutine
+			// from here, this is the most we can do from this package; it
+			// does not guarantee the goroutine exits.
+			//
+			// TODO: Have NetgearClient expose a context-aware or Close-able
+			// shutdown path so this can be fixed for real.
+			ticker.Stop()
+			return ctx.Err()
+		case <-reevaluate.C:
+			dt.evaluatePresence()
+		}
+	}
 }
@@ -0,0 +1,196 @@
+package lightson
+
+import "time"
+
+// Clock returns the current time. It exists so a SceneSelector's rules can
+// be evaluated against a fixed point in time in tests.
+type Clock func() time.Time
+
+// solarEvent identifies a sun-position-derived event used as a TimeBound.
+type solarEvent int
+
+const (
+	sunriseEvent solarEvent = iota
+	sunsetEvent
+)
+
+// TimeBound is a single point in a day used to bound a SceneRule, either a
+// fixed local time of day or an offset from a solar event. Construct one
+// with At, Sunrise, or Sunset.
+type TimeBound struct {
+	hour, minute int
+
+	isSolar bool
+	solar   solarEvent
+	offset  time.Duration
+}
+
+// At returns a TimeBound for a fixed local time of day.
+func At(hour, minute int) TimeBound {
+	return TimeBound{hour: hour, minute: minute}
+}
+
+// Sunrise returns a TimeBound offset from sunrise, e.g. Sunrise(-30 *
+// time.Minute) for 30 minutes before sunrise.
+func Sunrise(offset time.Duration) TimeBound {
+	return TimeBound{isSolar: true, solar: sunriseEvent, offset: offset}
+}
+
+// Sunset returns a TimeBound offset from sunset.
+func Sunset(offset time.Duration) TimeBound {
+	return TimeBound{isSolar: true, solar: sunsetEvent, offset: offset}
+}
+
+// resolve returns the time.Time this bound refers to on the day of now, in
+// now's time zone, using loc to compute sunrise/sunset for solar bounds.
+func (b TimeBound) resolve(now time.Time, loc Location) time.Time {
+	if !b.isSolar {
+		return time.Date(now.Year(), now.Month(), now.Day(), b.hour, b.minute, 0, 0, now.Location())
+	}
+
+	// Anchor the solar calculation to local noon of now's calendar day, in
+	// now's own time zone. Computing it from now directly would bind the
+	// sunrise/sunset to whatever day now's UTC instant happens to fall on,
+	// which can be a different calendar day than the one the rule is meant
+	// to evaluate against.
+	localNoon := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, now.Location())
+
+	sunrise, sunset := sunTimes(localNoon, loc)
+
+	event := sunrise
+	if b.solar == sunsetEvent {
+		event = sunset
+	}
+
+	return event.In(now.Location()).Add(b.offset)
+}
+
+// SceneRule selects a scene to recall while the current time falls within
+// [Start, End) on one of Days.
+type SceneRule struct {
+	// Scene is the name of the scene to recall while this rule is active.
+	Scene string
+
+	// Start and End bound the window during which this rule applies. A
+	// window that wraps midnight (End resolving before Start) is treated as
+	// spanning into the next day.
+	Start, End TimeBound
+
+	// Days restricts the rule to specific days of the week. An empty slice
+	// matches every day.
+	Days []time.Weekday
+}
+
+// matchesDay reports whether the rule applies on the given day.
+func (r SceneRule) matchesDay(day time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+
+	for _, d := range r.Days {
+		if d == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches reports whether the rule is active at now.
+func (r SceneRule) matches(now time.Time, loc Location) bool {
+	if !r.matchesDay(now.Weekday()) {
+		return false
+	}
+
+	start := r.Start.resolve(now, loc)
+	end := r.End.resolve(now, loc)
+
+	if end.Before(start) {
+		return !now.Before(start) || now.Before(end)
+	}
+
+	return !now.Before(start) && now.Before(end)
+}
+
+// SceneSelector picks which scene should be active at a given moment, based
+// on an ordered list of time-of-day and sun-position rules, and enforces a
+// cooldown between recalls of the same scene.
+type SceneSelector struct {
+	// Location is used to compute sunrise/sunset for solar TimeBounds.
+	Location Location
+
+	// Rules are evaluated in order; the first one that matches the current
+	// time wins.
+	Rules []SceneRule
+
+	// Default is used when no rule matches.
+	Default string
+
+	// RecallCooldown is the minimum time that must pass since a scene was
+	// last recalled before it may be recalled again.
+	RecallCooldown time.Duration
+
+	// Clock returns the current time. Defaults to time.Now if unset.
+	Clock Clock
+
+	lastRecall map[string]time.Time
+}
+
+// now returns the current time, via Clock if set, or time.Now otherwise.
+func (s *SceneSelector) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+
+	return time.Now()
+}
+
+// Scene returns the name of the scene that should currently be active.
+func (s *SceneSelector) Scene() string {
+	now := s.now()
+
+	for _, rule := range s.Rules {
+		if rule.matches(now, s.Location) {
+			return rule.Scene
+		}
+	}
+
+	return s.Default
+}
+
+// allScenes returns the distinct scene names referenced by the selector.
+func (s *SceneSelector) allScenes() []string {
+	seen := map[string]bool{}
+	var scenes []string
+
+	add := func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		scenes = append(scenes, name)
+	}
+
+	add(s.Default)
+	for _, rule := range s.Rules {
+		add(rule.Scene)
+	}
+
+	return scenes
+}
+
+// readyToRecall reports whether scene may be recalled, given the time it
+// was last recalled and RecallCooldown.
+func (s *SceneSelector) readyToRecall(scene string) bool {
+	last, ok := s.lastRecall[scene]
+	return !ok || s.now().Sub(last) >= s.RecallCooldown
+}
+
+// markRecalled records that scene was just recalled.
+func (s *SceneSelector) markRecalled(scene string) {
+	if s.lastRecall == nil {
+		s.lastRecall = map[string]time.Time{}
+	}
+
+	s.lastRecall[scene] = s.now()
+}
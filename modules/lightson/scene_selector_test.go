@@ -0,0 +1,134 @@
+package lightson
+
+import (
+	"testing"
+	"time"
+)
+
+// sfLocation approximates San Francisco, used to exercise sunrise/sunset
+// bounds against known-reasonable times.
+var sfLocation = Location{Latitude: 37.7749, Longitude: -122.4194}
+
+func mockClock(t time.Time) Clock {
+	return func() time.Time { return t }
+}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2023, time.June, 15, hour, minute, 0, 0, time.UTC)
+}
+
+func TestSceneSelectorTimeOfDayRules(t *testing.T) {
+	selector := &SceneSelector{
+		Rules: []SceneRule{
+			{Scene: "Evening", Start: At(18, 0), End: At(23, 0)},
+			{Scene: "Nightlight", Start: At(23, 0), End: At(6, 0)},
+		},
+		Default: "Daytime",
+	}
+
+	cases := []struct {
+		now  time.Time
+		want string
+	}{
+		{at(10, 0), "Daytime"},
+		{at(18, 0), "Evening"},
+		{at(22, 59), "Evening"},
+		{at(23, 0), "Nightlight"},
+		{at(2, 0), "Nightlight"},
+		{at(5, 59), "Nightlight"},
+		{at(6, 0), "Daytime"},
+	}
+
+	for _, c := range cases {
+		selector.Clock = mockClock(c.now)
+
+		if got := selector.Scene(); got != c.want {
+			t.Errorf("Scene() at %s = %q, want %q", c.now.Format("15:04"), got, c.want)
+		}
+	}
+}
+
+func TestSceneSelectorDayOfWeek(t *testing.T) {
+	selector := &SceneSelector{
+		Rules: []SceneRule{
+			{Scene: "WeekendMorning", Start: At(7, 0), End: At(10, 0), Days: []time.Weekday{time.Saturday, time.Sunday}},
+		},
+		Default: "Daytime",
+	}
+
+	saturday := time.Date(2023, time.June, 17, 8, 0, 0, 0, time.UTC)
+	thursday := time.Date(2023, time.June, 15, 8, 0, 0, 0, time.UTC)
+
+	selector.Clock = mockClock(saturday)
+	if got := selector.Scene(); got != "WeekendMorning" {
+		t.Errorf("Scene() on Saturday = %q, want WeekendMorning", got)
+	}
+
+	selector.Clock = mockClock(thursday)
+	if got := selector.Scene(); got != "Daytime" {
+		t.Errorf("Scene() on Thursday = %q, want Daytime", got)
+	}
+}
+
+func TestSceneSelectorSunsetRule(t *testing.T) {
+	selector := &SceneSelector{
+		Location: sfLocation,
+		Rules: []SceneRule{
+			{Scene: "Evening", Start: Sunset(-30 * time.Minute), End: At(23, 0)},
+		},
+		Default: "Daytime",
+	}
+
+	// Use a fixed local zone, rather than raw UTC, so that sunset and the
+	// "now" instants derived from it fall on the same local calendar day
+	// that noon does - sunset in UTC can land on the following UTC day.
+	pdt := time.FixedZone("PDT", -7*60*60)
+	noon := time.Date(2023, time.June, 15, 12, 0, 0, 0, pdt)
+
+	sunrise, sunset := sunTimes(noon, sfLocation)
+	sunset = sunset.In(pdt)
+
+	if !sunrise.Before(sunset) {
+		t.Fatalf("expected sunrise %s before sunset %s", sunrise, sunset)
+	}
+
+	if sunset.Day() != noon.Day() {
+		t.Fatalf("expected sunset %s to fall on the same local day as noon %s", sunset, noon)
+	}
+
+	selector.Clock = mockClock(sunset.Add(-time.Hour))
+	if got := selector.Scene(); got != "Daytime" {
+		t.Errorf("Scene() an hour before sunset = %q, want Daytime", got)
+	}
+
+	selector.Clock = mockClock(sunset.Add(-10 * time.Minute))
+	if got := selector.Scene(); got != "Evening" {
+		t.Errorf("Scene() 10m before sunset = %q, want Evening", got)
+	}
+}
+
+func TestSceneSelectorRecallCooldown(t *testing.T) {
+	now := at(18, 0)
+
+	selector := &SceneSelector{
+		Default:        "Evening",
+		RecallCooldown: time.Hour,
+		Clock:          mockClock(now),
+	}
+
+	if !selector.readyToRecall("Evening") {
+		t.Fatalf("expected scene to be ready to recall before any recall")
+	}
+
+	selector.markRecalled("Evening")
+
+	if selector.readyToRecall("Evening") {
+		t.Fatalf("expected scene to be within cooldown immediately after recall")
+	}
+
+	selector.Clock = mockClock(now.Add(time.Hour + time.Minute))
+
+	if !selector.readyToRecall("Evening") {
+		t.Fatalf("expected scene to be ready to recall after cooldown elapsed")
+	}
+}
@@ -0,0 +1,86 @@
+package lightson
+
+import (
+	"math"
+	"time"
+)
+
+// Location is a latitude/longitude pair, in degrees, used to compute solar
+// events for a SceneSelector.
+type Location struct {
+	// Latitude in degrees, positive north.
+	Latitude float64
+
+	// Longitude in degrees, positive east.
+	Longitude float64
+}
+
+const (
+	degToRad = math.Pi / 180
+	radToDeg = 180 / math.Pi
+
+	// julianEpoch is the Julian date of the Unix epoch, 1970-01-01 00:00 UTC.
+	julianEpoch = 2440587.5
+
+	// earthAxialTilt is Earth's mean axial tilt in degrees, used to derive
+	// the sun's declination.
+	earthAxialTilt = 23.44
+
+	// solarZenith is the sun's zenith angle, in degrees, at sunrise/sunset,
+	// corrected for atmospheric refraction and the sun's apparent radius.
+	solarZenith = 90.833
+)
+
+// julianDay converts t to a Julian date.
+func julianDay(t time.Time) float64 {
+	return float64(t.Unix())/86400 + julianEpoch
+}
+
+// fromJulianDay converts a Julian date back to a time.Time in UTC.
+func fromJulianDay(jd float64) time.Time {
+	return time.Unix(int64(math.Round((jd-julianEpoch)*86400)), 0).UTC()
+}
+
+// sunTimes computes the sunrise and sunset times for the given day (any
+// time within the day, in any time zone) at loc, using the Sunrise
+// equation: https://en.wikipedia.org/wiki/Sunrise_equation.
+//
+// At latitudes where the sun doesn't rise or set on the given day, the
+// result is clamped to local solar noon/midnight rather than returning an
+// error, since callers only ever compare against these times.
+func sunTimes(day time.Time, loc Location) (sunrise, sunset time.Time) {
+	n := math.Round(julianDay(day) - 2451545.0 + 0.0008)
+
+	// Mean solar noon.
+	jStar := n - loc.Longitude/360
+
+	// Solar mean anomaly.
+	m := math.Mod(357.5291+0.98560028*jStar, 360)
+	mRad := m * degToRad
+
+	// Equation of the center.
+	c := 1.9148*math.Sin(mRad) + 0.0200*math.Sin(2*mRad) + 0.0003*math.Sin(3*mRad)
+
+	// Ecliptic longitude.
+	lambda := math.Mod(m+102.9372+c+180, 360)
+	lambdaRad := lambda * degToRad
+
+	// Solar transit, the Julian date of solar noon at loc.
+	jTransit := 2451545.0 + jStar + 0.0053*math.Sin(mRad) - 0.0069*math.Sin(2*lambdaRad)
+
+	// Declination of the sun.
+	sinDelta := math.Sin(lambdaRad) * math.Sin(earthAxialTilt*degToRad)
+	delta := math.Asin(sinDelta)
+
+	latRad := loc.Latitude * degToRad
+
+	cosOmega := (math.Cos(solarZenith*degToRad) - math.Sin(latRad)*sinDelta) /
+		(math.Cos(latRad) * math.Cos(delta))
+
+	// Clamp rather than propagating NaN on polar day/night.
+	cosOmega = math.Max(-1, math.Min(1, cosOmega))
+
+	omega := math.Acos(cosOmega) * radToDeg
+
+	return fromJulianDay(jTransit - omega/360), fromJulianDay(jTransit + omega/360)
+}
@@ -0,0 +1,48 @@
+// Package metrics defines the Prometheus metrics this daemon exports on
+// /metrics, shared between the httplights server and lightson trigger so
+// both can be observed under systemd or Kubernetes.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	// SceneRecalls counts scene recall attempts, labeled by the scene name
+	// and whether the recall succeeded.
+	SceneRecalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "atmosphere_scene_recalls_total",
+		Help: "Total number of scene recall attempts.",
+	}, []string{"scene", "result"})
+
+	// TriggerEvents counts presence device connect/disconnect events seen
+	// by a DeviceLightsTrigger.
+	TriggerEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "atmosphere_trigger_events_total",
+		Help: "Total number of presence device connect/disconnect events.",
+	}, []string{"event"})
+
+	// BridgeErrors counts errors returned by a lights.Controller, labeled
+	// by the operation that failed.
+	BridgeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "atmosphere_bridge_errors_total",
+		Help: "Total number of errors returned by a light controller.",
+	}, []string{"operation"})
+
+	// DebounceCancellations counts devices reconnecting within their own
+	// debounce window, before their absence would have affected aggregate
+	// presence.
+	DebounceCancellations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "atmosphere_debounce_cancellations_total",
+		Help: "Total number of device reconnects that happened within the debounce window.",
+	})
+
+	// DevicePresent reports whether aggregate device presence is currently
+	// held (1) or not (0), as tracked by a DeviceLightsTrigger.
+	DevicePresent = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "atmosphere_device_present",
+		Help: "Whether aggregate device presence is currently held.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(SceneRecalls, TriggerEvents, BridgeErrors, DebounceCancellations, DevicePresent)
+}